@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/pelletier/go-toml"
+
+	"github.com/nhooyr/color/log"
+)
+
+// tokenHTTPClient bounds how long an OAuth token refresh can block the
+// caller (typically smtpNotifier.dial, on the daemon's send path).
+var tokenHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// auth holds the SASL configuration for an account. For the oauth
+// mechanisms, client regenerates the sasl.Client from a fresh token on
+// every call, since tokens typically expire in under an hour.
+type auth struct {
+	mechanism    string
+	password     string
+	tokenCommand string
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	refreshToken string
+}
+
+// parseAuth reads the optional [auth] table of an account block.
+// Accounts without one keep today's behavior: PLAIN auth with password.
+func parseAuth(tree *toml.TomlTree, password string) *auth {
+	v := tree.Get("auth")
+	if v == nil {
+		return &auth{mechanism: "plain", password: password}
+	}
+	authTree, ok := v.(*toml.TomlTree)
+	if !ok {
+		log.Fatalf("%s: type of %q is incorrect, should be table", pos(tree, "auth"), "auth")
+	}
+	a := &auth{
+		mechanism: necessary(authTree, "mechanism"),
+		password:  password,
+	}
+	switch a.mechanism {
+	case "plain", "login":
+	case "xoauth2", "oauthbearer":
+		a.tokenCommand = optional(authTree, "token_command")
+		a.tokenURL = optional(authTree, "token_url")
+		a.clientID = optional(authTree, "client_id")
+		a.clientSecret = optional(authTree, "client_secret")
+		a.refreshToken = optional(authTree, "refresh_token")
+		if a.tokenCommand == "" && a.refreshToken == "" {
+			log.Fatalf("%s: mechanism %q requires either %q or %q", pos(authTree, "mechanism"), a.mechanism, "token_command", "refresh_token")
+		}
+		if a.tokenCommand == "" && a.refreshToken != "" && a.tokenURL == "" {
+			log.Fatalf("%s: mechanism %q with %q also requires %q", pos(authTree, "mechanism"), a.mechanism, "refresh_token", "token_url")
+		}
+	default:
+		log.Fatalf("%s: unknown auth mechanism %q", pos(authTree, "mechanism"), a.mechanism)
+	}
+	return a
+}
+
+// token returns a fresh OAuth access token, either by running
+// token_command or by performing the refresh_token grant against
+// token_url.
+func (a *auth) token() (string, error) {
+	if a.tokenCommand != "" {
+		out, err := exec.Command("sh", "-c", a.tokenCommand).Output()
+		if err != nil {
+			return "", fmt.Errorf("token_command: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	resp, err := tokenHTTPClient.PostForm(a.tokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {a.refreshToken},
+		"client_id":     {a.clientID},
+		"client_secret": {a.clientSecret},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, respBody)
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(respBody, &body); err != nil {
+		return "", err
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("token endpoint response missing access_token")
+	}
+	return body.AccessToken, nil
+}
+
+// client builds a sasl.Client for username according to a.mechanism,
+// fetching a fresh OAuth token first when one is required.
+func (a *auth) client(username string) (sasl.Client, error) {
+	switch a.mechanism {
+	case "plain":
+		return sasl.NewPlainClient("", username, a.password), nil
+	case "login":
+		return sasl.NewLoginClient(username, a.password), nil
+	case "xoauth2":
+		token, err := a.token()
+		if err != nil {
+			return nil, fmt.Errorf("xoauth2: %w", err)
+		}
+		return newXOAuth2Client(username, token), nil
+	case "oauthbearer":
+		token, err := a.token()
+		if err != nil {
+			return nil, fmt.Errorf("oauthbearer: %w", err)
+		}
+		return sasl.NewOAuthBearerClient(&sasl.OAuthBearerOptions{Username: username, Token: token}), nil
+	}
+	return nil, fmt.Errorf("unknown auth mechanism %q", a.mechanism)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// journalTail captures the last n lines of `journalctl -u unit` as an
+// attachment, where n is the account's journal_tail_lines TOML knob.
+// It returns nil, nil if journal attachment isn't enabled for this
+// account, so callers in the monitor loop can call it unconditionally
+// and add the result to Send's attachments only when it is non-nil.
+func (s *smtpNotifier) journalTail(unit string) (*attachment, error) {
+	if s.journalTailLines <= 0 {
+		return nil, nil
+	}
+	out, err := exec.Command("journalctl", "-u", unit, "-n", strconv.Itoa(s.journalTailLines), "--no-pager").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("journalctl -u %s: %w", unit, err)
+	}
+	return &attachment{filename: unit + ".log", data: out}, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// attachment is a single file to include as a MIME part in an outgoing
+// message, e.g. the tail of a unit's journal log.
+type attachment struct {
+	filename string
+	data     []byte
+}
+
+// message is a reusable buffer for composing an outgoing email. The
+// boilerplate headers (From, To, start of Subject) are written once
+// during smtpNotifier.init and initialized marks that point so reset can
+// cheaply rewind the buffer between sends instead of reallocating.
+type message struct {
+	buf       []byte
+	headerLen int
+}
+
+func (m *message) write(s string) {
+	m.buf = append(m.buf, s...)
+}
+
+func (m *message) writeByte(b byte) {
+	m.buf = append(m.buf, b)
+}
+
+func (m *message) writeBytes(b []byte) {
+	m.buf = append(m.buf, b...)
+}
+
+func (m *message) writeEmail(name, email string) {
+	if name != "" {
+		m.write(name)
+		m.writeByte(' ')
+	}
+	m.writeByte('<')
+	m.write(email)
+	m.writeByte('>')
+}
+
+func (m *message) initialized() {
+	m.headerLen = len(m.buf)
+}
+
+func (m *message) reset() {
+	m.buf = m.buf[:m.headerLen]
+}
+
+// newBoundary returns a random MIME multipart boundary token.
+func newBoundary() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generating MIME boundary: %w", err)
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+// writeBase64 appends data to m base64-encoded and wrapped at 76
+// columns, per RFC 2045.
+func (m *message) writeBase64(data []byte) {
+	enc := base64.StdEncoding
+	buf := make([]byte, enc.EncodedLen(len(data)))
+	enc.Encode(buf, data)
+	for len(buf) > 76 {
+		m.writeBytes(buf[:76])
+		m.write("\r\n")
+		buf = buf[76:]
+	}
+	m.writeBytes(buf)
+}
+
+// writeAttachment appends at as an application/octet-stream part of the
+// multipart/mixed message delimited by boundary.
+func (m *message) writeAttachment(boundary string, at attachment) {
+	m.write("--")
+	m.write(boundary)
+	m.write("\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\nContent-Disposition: attachment; filename=\"")
+	m.write(at.filename)
+	m.write("\"\r\n\r\n")
+	m.writeBase64(at.data)
+	m.write("\r\n")
+}
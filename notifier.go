@@ -0,0 +1,7 @@
+package main
+
+// Notifier delivers an alert about unit to some external channel,
+// optionally with attachments (e.g. that unit's journal tail).
+type Notifier interface {
+	Send(unit, subject string, body []byte, attachments []attachment) error
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+)
+
+// sendmailMain implements a sendmail(1)-compatible CLI mode: it reads an
+// RFC 5322 message from stdin, picks the configured account whose
+// username matches the message's From header, and relays the message
+// through that account's existing authenticated, STARTTLS-aware,
+// backup-fallback SMTP connection. Wired up behind
+// `systemd-monitor sendmail`, it lets e.g. /usr/sbin/sendmail point here
+// so cron, git send-email, etc. reuse the monitor's transport.
+func sendmailMain(args []string, accounts []*account) error {
+	fs := flag.NewFlagSet("sendmail", flag.ContinueOnError)
+	extractRecipients := fs.Bool("t", false, "read recipients from To/Cc/Bcc headers")
+	from := fs.String("f", "", "envelope sender (defaults to the From header)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	raw, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("reading message: %w", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("parsing message: %w", err)
+	}
+
+	addr, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return fmt.Errorf("parsing From header: %w", err)
+	}
+	a := accountForUsername(accounts, addr.Address)
+	if a == nil {
+		return fmt.Errorf("no configured account matches From address %q", addr.Address)
+	}
+
+	fromAddr := addr.Address
+	if *from != "" {
+		fromAddr = *from
+	}
+
+	var recipients []string
+	if *extractRecipients {
+		recipients, err = headerAddresses(msg.Header, "To", "Cc", "Bcc")
+		if err != nil {
+			return err
+		}
+	} else {
+		recipients = fs.Args()
+	}
+	if len(recipients) == 0 {
+		return errors.New("no recipients: pass -t or list addresses")
+	}
+
+	return a.Relay(fromAddr, recipients, stripHeader(raw, "Bcc"))
+}
+
+// accountForUsername returns the account whose underlying smtpNotifier
+// username matches from, either in full or as the local part before '@'.
+func accountForUsername(accounts []*account, from string) *account {
+	local := from
+	if i := strings.IndexByte(from, '@'); i != -1 {
+		local = from[:i]
+	}
+	for _, a := range accounts {
+		s, ok := a.notifier.(*smtpNotifier)
+		if !ok {
+			continue
+		}
+		if s.username == from || s.username == local {
+			return a
+		}
+	}
+	return nil
+}
+
+// headerAddresses collects and flattens the address lists of the given
+// headers, in order.
+func headerAddresses(header mail.Header, names ...string) ([]string, error) {
+	var addrs []string
+	for _, name := range names {
+		list, err := header.AddressList(name)
+		if err != nil && err != mail.ErrHeaderNotPresent {
+			return nil, fmt.Errorf("parsing %s header: %w", name, err)
+		}
+		for _, addr := range list {
+			addrs = append(addrs, addr.Address)
+		}
+	}
+	return addrs, nil
+}
+
+// stripHeader removes every occurrence (and any folded continuation
+// lines) of the named header from a raw RFC 5322 message, so it never
+// reaches DATA on the wire. Used to drop Bcc before relaying.
+func stripHeader(raw []byte, name string) []byte {
+	prefix := []byte(name + ":")
+	lines := bytes.SplitAfter(raw, []byte("\n"))
+	out := make([]byte, 0, len(raw))
+	inHeaders := true
+	skipping := false
+	for _, line := range lines {
+		if !inHeaders {
+			out = append(out, line...)
+			continue
+		}
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if len(trimmed) == 0 {
+			inHeaders = false
+			skipping = false
+			out = append(out, line...)
+			continue
+		}
+		if skipping && (trimmed[0] == ' ' || trimmed[0] == '\t') {
+			continue
+		}
+		skipping = false
+		if len(trimmed) >= len(prefix) && strings.EqualFold(string(trimmed[:len(prefix)]), string(prefix)) {
+			skipping = true
+			continue
+		}
+		out = append(out, line...)
+	}
+	return out
+}
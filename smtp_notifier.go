@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/nhooyr/color/log"
+	"github.com/pelletier/go-toml"
+)
+
+// smtpNotifier is the original notifier: it relays alerts as email
+// through an authenticated SMTP submission connection.
+type smtpNotifier struct {
+	username              string
+	host                  string
+	addr                  string
+	auth                  *auth
+	tlsMode               string
+	tlsInsecureSkipVerify bool
+	caFile                string
+	c                     *smtp.Client
+	msg                   *message
+	destinations          []string
+	last                  time.Time
+	journalTailLines      int
+}
+
+func (s *smtpNotifier) init(tree *toml.TomlTree) {
+	s.addr = necessary(tree, "addr")
+	var err error
+	s.host, _, err = net.SplitHostPort(s.addr)
+	if err != nil {
+		log.Fatalf("%s: addr is not in %q format", pos(tree, "addr"), "host:port")
+	}
+
+	s.username = necessary(tree, "username")
+	s.auth = parseAuth(tree, optional(tree, "password"))
+
+	s.tlsMode = optional(tree, "tls")
+	if s.tlsMode == "" {
+		s.tlsMode = "starttls"
+	}
+	switch s.tlsMode {
+	case "starttls", "implicit", "none":
+	default:
+		log.Fatalf("%s: unknown %q mode %q", pos(tree, "tls"), "tls", s.tlsMode)
+	}
+	if v := tree.Get("tls_insecure_skip_verify"); v != nil {
+		skip, ok := v.(bool)
+		if !ok {
+			log.Fatalf("%s: type of %q is incorrect, should be boolean", pos(tree, "tls_insecure_skip_verify"), "tls_insecure_skip_verify")
+		}
+		s.tlsInsecureSkipVerify = skip
+	}
+	s.caFile = optional(tree, "ca_file")
+
+	if err = s.dial(); err != nil {
+		log.Printf("%s: error connecting to %s: %s", pos(tree, "addr"), s.addr, err)
+	}
+	v := tree.Get("destinations")
+	if v == nil {
+		log.Fatalf("%s: missing %q table of arrays", pos(tree, ""), "destinations")
+	}
+	trees, ok := v.([]*toml.TomlTree)
+	if !ok {
+		log.Fatalf("%s: type of %q is incorrect, should be table of arrays", pos(tree, "destinations"), "destinations")
+	}
+
+	if v := tree.Get("journal_tail_lines"); v != nil {
+		n, ok := v.(int64)
+		if !ok {
+			log.Fatalf("%s: type of %q is incorrect, should be integer", pos(tree, "journal_tail_lines"), "journal_tail_lines")
+		}
+		s.journalTailLines = int(n)
+	}
+
+	s.msg = &message{buf: make([]byte, 0, 3000)}
+	s.msg.write("From: ")
+	s.msg.writeEmail("systemd", s.username)
+	s.msg.write("\r\nTo:")
+	s.destinations = make([]string, len(trees))
+	for i, tree := range trees {
+		name := optional(tree, "name")
+		email := necessary(tree, "email")
+		s.destinations[i] = email
+		s.msg.writeByte(' ')
+		s.msg.writeEmail(name, email)
+		if i != len(trees)-1 {
+			s.msg.writeByte(',')
+		}
+		s.msg.write("\r\n")
+	}
+	s.msg.write("Subject: ")
+	s.msg.initialized()
+}
+
+var errTimeout = errors.New("reconnection timeout")
+var errNoSTARTTLS = errors.New("server does not advertise STARTTLS")
+
+// tlsConfig builds the *tls.Config used for both implicit TLS and
+// STARTTLS, loading ca_file if one was configured.
+func (s *smtpNotifier) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: s.host, InsecureSkipVerify: s.tlsInsecureSkipVerify}
+	if s.caFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(s.caFile)
+	if err != nil {
+		return nil, fmt.Errorf("ca_file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("ca_file: no certificates found in %s", s.caFile)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+func (s *smtpNotifier) dial() (err error) {
+	now := time.Now()
+	if now.Sub(s.last) < time.Second*30 {
+		return errTimeout
+	}
+	s.last = now
+
+	if s.tlsMode == "implicit" {
+		cfg, err2 := s.tlsConfig()
+		if err2 != nil {
+			return err2
+		}
+		if s.c, err = smtp.DialTLS(s.addr, cfg); err != nil {
+			return
+		}
+	} else {
+		if s.c, err = smtp.Dial(s.addr); err != nil {
+			return
+		}
+		ok, _ := s.c.Extension("STARTTLS")
+		switch {
+		case ok:
+			cfg, err2 := s.tlsConfig()
+			if err2 != nil {
+				return err2
+			}
+			if err = s.c.StartTLS(cfg); err != nil {
+				return
+			}
+		case s.tlsMode == "starttls":
+			return errNoSTARTTLS
+		default:
+			log.Printf("%s: warning: connecting to %s without TLS", s.username, s.addr)
+		}
+	}
+
+	if ok, _ := s.c.Extension("AUTH"); ok && s.auth != nil {
+		var client sasl.Client
+		if client, err = s.auth.client(s.username); err != nil {
+			return
+		}
+		if err = s.c.Auth(client); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// isAuthError reports whether err is an SMTP 535 (authentication
+// failed) response, which usually means an OAuth token expired mid
+// connection.
+func isAuthError(err error) bool {
+	var smtpErr *smtp.SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code == 535
+	}
+	return false
+}
+
+// Send implements Notifier. unit is unused here: the account's
+// destinations and From line already say everything an email needs.
+// It reconnects and retries once on failure (forcing a token refresh
+// first if the failure was an auth error) before giving up; the caller
+// is responsible for falling back further.
+func (s *smtpNotifier) Send(unit, subject string, body []byte, attachments []attachment) error {
+	err := s.mail(subject, body, attachments)
+	if err == nil {
+		return nil
+	}
+	if isAuthError(err) {
+		log.Printf("%s: auth failure, forcing token refresh", s.username)
+		s.last = time.Time{}
+	}
+	log.Printf("%s: reconnecting", s.username)
+	if err2 := s.dial(); err2 != nil {
+		return err
+	}
+	return s.mail(subject, body, attachments)
+}
+
+var errNilClient = errors.New("nil client")
+
+func (s *smtpNotifier) mail(subject string, body []byte, attachments []attachment) (err error) {
+	if s.c == nil {
+		return errNilClient
+	}
+	defer s.msg.reset()
+	s.msg.write(subject)
+	if len(attachments) == 0 {
+		s.msg.write("\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+		s.msg.writeBytes(body)
+	} else {
+		boundary, err := newBoundary()
+		if err != nil {
+			return err
+		}
+		s.msg.write(fmt.Sprintf("\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n--%s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n", boundary, boundary))
+		s.msg.writeBytes(body)
+		s.msg.write("\r\n")
+		for _, at := range attachments {
+			s.msg.writeAttachment(boundary, at)
+		}
+		s.msg.write(fmt.Sprintf("--%s--\r\n", boundary))
+	}
+	if err = s.c.Mail(s.username, nil); err != nil {
+		return
+	}
+	for _, addr := range s.destinations {
+		if err = s.c.Rcpt(addr, nil); err != nil {
+			return
+		}
+	}
+	w, err := s.c.Data()
+	if err != nil {
+		return
+	}
+	_, err = w.Write(s.msg.buf)
+	if err != nil {
+		return
+	}
+	return w.Close()
+}
+
+// relay sends a fully-formed RFC 5322 message as-is to recipients,
+// bypassing the prebuilt monitor-alert template in s.msg. This is the
+// path the sendmail subcommand uses. It reconnects and retries once on
+// this account's own connection, same as Send; falling back to a
+// backup account, if any, is account.Relay's job.
+func (s *smtpNotifier) relay(from string, recipients []string, data []byte) error {
+	if s.c == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+	if err := s.deliver(from, recipients, data); err != nil {
+		if isAuthError(err) {
+			log.Printf("%s: auth failure, forcing token refresh", s.username)
+			s.last = time.Time{}
+		}
+		log.Printf("%s: reconnecting", s.username)
+		if err2 := s.dial(); err2 != nil {
+			return err
+		}
+		return s.deliver(from, recipients, data)
+	}
+	return nil
+}
+
+func (s *smtpNotifier) deliver(from string, recipients []string, data []byte) error {
+	if s.c == nil {
+		return errNilClient
+	}
+	if err := s.c.Mail(from, nil); err != nil {
+		return err
+	}
+	for _, to := range recipients {
+		if err := s.c.Rcpt(to, nil); err != nil {
+			return err
+		}
+	}
+	w, err := s.c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nhooyr/color/log"
+	"github.com/pelletier/go-toml"
+)
+
+// webhookHTTPClient bounds how long a slow or unresponsive endpoint can
+// stall the account's send path, mirroring the dial/reconnect timeout
+// semantics smtpNotifier relies on.
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookNotifier delivers an alert as a JSON POST, for routing to
+// Slack/Discord/Matrix bridges or any other HTTP-reachable endpoint.
+type webhookNotifier struct {
+	name    string
+	url     string
+	headers map[string]string
+	secret  []byte
+}
+
+func (w *webhookNotifier) init(tree *toml.TomlTree) {
+	w.name = necessary(tree, "name")
+	w.url = necessary(tree, "url")
+
+	if v := tree.Get("headers"); v != nil {
+		headersTree, ok := v.(*toml.TomlTree)
+		if !ok {
+			log.Fatalf("%s: type of %q is incorrect, should be table", pos(tree, "headers"), "headers")
+		}
+		w.headers = make(map[string]string)
+		for _, k := range headersTree.Keys() {
+			val, ok := headersTree.Get(k).(string)
+			if !ok {
+				log.Fatalf("%s: type of %q is incorrect, should be string", pos(headersTree, k), k)
+			}
+			w.headers[k] = val
+		}
+	}
+
+	if secret := optional(tree, "secret"); secret != "" {
+		w.secret = []byte(secret)
+	}
+}
+
+// webhookPayload is the JSON body POSTed to url.
+type webhookPayload struct {
+	Unit      string    `json:"unit"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Send implements Notifier.
+func (w *webhookNotifier) Send(unit, subject string, body []byte, attachments []attachment) error {
+	payload, err := json.Marshal(webhookPayload{
+		Unit:      unit,
+		Subject:   subject,
+		Body:      string(body),
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	if w.secret != nil {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(payload)
+		req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import "fmt"
+
+// xoauth2Client implements the Gmail/Office365 "XOAUTH2" SASL mechanism.
+// It predates and is shaped slightly differently from RFC 7628's
+// OAUTHBEARER, so go-sasl doesn't ship it.
+type xoauth2Client struct {
+	username string
+	token    string
+}
+
+func newXOAuth2Client(username, token string) *xoauth2Client {
+	return &xoauth2Client{username: username, token: token}
+}
+
+func (c *xoauth2Client) Start() (mech string, ir []byte, err error) {
+	ir = []byte(fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", c.username, c.token))
+	return "XOAUTH2", ir, nil
+}
+
+func (c *xoauth2Client) Next(challenge []byte) (response []byte, err error) {
+	return nil, fmt.Errorf("xoauth2: unexpected server challenge: %s", challenge)
+}